@@ -16,7 +16,9 @@ package statistics
 import (
 	"context"
 	"math/rand"
+	"sync"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tikv/pd/server/core"
 )
 
@@ -24,21 +26,99 @@ import (
 // only turned off by the simulator and the test.
 var Denoising = true
 
-const queueCap = 1000
+const (
+	queueCap = 1000
+	// defaultBatchSize is how many regions updateItems drains and processes
+	// per iteration when no HotCacheOption overrides it.
+	defaultBatchSize = 64
+	// hotCacheWorkerCount bounds how many regions are processed concurrently
+	// out of a single batch.
+	hotCacheWorkerCount = 4
+)
+
+var hotCacheFlowQueueDroppedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "pd",
+		Subsystem: "hotspot",
+		Name:      "hot_cache_flow_queue_dropped_regions_total",
+		Help:      "Counter of regions dropped from the hot cache flow queue because it was full.",
+	}, []string{"store", "kind"})
+
+func init() {
+	prometheus.MustRegister(hotCacheFlowQueueDroppedCounter)
+}
+
+// Dimension distinguishes the hotness metrics tracked for a peer. Unlike
+// FlowKind, which separates read and write traffic, a Dimension selects
+// which measurement of that traffic to look at (bytes, keys or queries).
+type Dimension int
+
+const (
+	// ByteDim is the byte-flow dimension.
+	ByteDim Dimension = iota
+	// KeyDim is the key-flow dimension.
+	KeyDim
+	// QueryDim is the query-count (QPS) dimension, computed from
+	// RegionInfo's write/read query-num counters in hotPeerCache.
+	QueryDim
+)
 
 // HotCache is a cache hold hot regions.
 type HotCache struct {
 	flowQueue chan *core.RegionInfo
 	writeFlow *hotPeerCache
 	readFlow  *hotPeerCache
+	queryFlow *hotPeerCache
+
+	batchSize int
+	coalesce  bool
+	mu        sync.Mutex
+	pending   map[uint64]*core.RegionInfo
+	notify    chan struct{}
+}
+
+// HotCacheOption configures a HotCache created by NewHotCache.
+type HotCacheOption func(*HotCache)
+
+// WithFlowQueueCapacity overrides the default capacity of the pending-region
+// queue. Heartbeats that arrive once the queue is full are dropped rather
+// than blocking the caller; see CheckRWAsync.
+func WithFlowQueueCapacity(n int) HotCacheOption {
+	return func(w *HotCache) {
+		w.flowQueue = make(chan *core.RegionInfo, n)
+	}
+}
+
+// WithBatchSize overrides how many regions updateItems drains and processes
+// per iteration.
+func WithBatchSize(n int) HotCacheOption {
+	return func(w *HotCache) {
+		w.batchSize = n
+	}
+}
+
+// WithCoalescedQueue makes CheckRWAsync keep only the most recently reported
+// RegionInfo per region ID instead of queuing every heartbeat, so a burst of
+// heartbeats for the same region doesn't waste work.
+func WithCoalescedQueue(enabled bool) HotCacheOption {
+	return func(w *HotCache) {
+		w.coalesce = enabled
+	}
 }
 
 // NewHotCache creates a new hot spot cache.
-func NewHotCache(ctx context.Context) *HotCache {
+func NewHotCache(ctx context.Context, opts ...HotCacheOption) *HotCache {
 	w := &HotCache{
 		flowQueue: make(chan *core.RegionInfo, queueCap),
 		writeFlow: NewHotStoresStats(WriteFlow),
 		readFlow:  NewHotStoresStats(ReadFlow),
+		queryFlow: NewHotStoresStats(QueryFlow),
+		batchSize: defaultBatchSize,
+		pending:   make(map[uint64]*core.RegionInfo),
+		notify:    make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(w)
 	}
 	go w.updateItems(ctx)
 	return w
@@ -56,9 +136,46 @@ func (w *HotCache) CheckReadSync(region *core.RegionInfo) []*HotPeerStat {
 	return w.readFlow.CheckRegionFlow(region)
 }
 
-// CheckRWAsync puts the region into queue, and check it asynchronously
+// CheckQuerySync checks the query status, returns update items.
+// This is used for mockcluster.
+func (w *HotCache) CheckQuerySync(region *core.RegionInfo) []*HotPeerStat {
+	return w.queryFlow.CheckRegionFlow(region)
+}
+
+// CheckRWAsync enqueues the region to be checked asynchronously. It never
+// blocks: once the queue (or, in coalesced mode, the most-recent-per-region
+// map) is full, the update is dropped and a metric is incremented instead of
+// back-pressuring the heartbeat handler.
 func (w *HotCache) CheckRWAsync(region *core.RegionInfo) {
-	w.flowQueue <- region
+	if w.coalesce {
+		w.enqueueCoalesced(region)
+		return
+	}
+	select {
+	case w.flowQueue <- region:
+	default:
+		w.incDroppedMetric(region)
+	}
+}
+
+func (w *HotCache) enqueueCoalesced(region *core.RegionInfo) {
+	w.mu.Lock()
+	if _, ok := w.pending[region.GetID()]; !ok && len(w.pending) >= cap(w.flowQueue) {
+		w.mu.Unlock()
+		w.incDroppedMetric(region)
+		return
+	}
+	w.pending[region.GetID()] = region
+	w.mu.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *HotCache) incDroppedMetric(region *core.RegionInfo) {
+	hotCacheFlowQueueDroppedCounter.WithLabelValues(storeTag(region.GetLeader().GetStoreId()), "rw").Inc()
 }
 
 // Update updates the cache.
@@ -68,6 +185,8 @@ func (w *HotCache) Update(item *HotPeerStat) {
 		w.writeFlow.Update(item)
 	case ReadFlow:
 		w.readFlow.Update(item)
+	case QueryFlow:
+		w.queryFlow.Update(item)
 	}
 
 	if item.IsNeedDelete() {
@@ -79,18 +198,32 @@ func (w *HotCache) Update(item *HotPeerStat) {
 	}
 }
 
-// RegionStats returns hot items according to kind
+// RegionStats returns hot items according to kind, on the ByteDim dimension.
+// It keeps its original two-argument shape so existing callers
+// (schedulers) that only care about byte flow don't need to change; use
+// RegionStatsOfDim to pick a specific Dimension.
 func (w *HotCache) RegionStats(kind FlowKind, minHotDegree int) map[uint64][]*HotPeerStat {
+	return w.RegionStatsOfDim(kind, ByteDim, minHotDegree)
+}
+
+// RegionStatsOfDim returns hot items according to kind and dimension, e.g.
+// the stores that are hot on QueryDim even though their ByteDim throughput
+// looks moderate.
+func (w *HotCache) RegionStatsOfDim(kind FlowKind, dim Dimension, minHotDegree int) map[uint64][]*HotPeerStat {
 	switch kind {
 	case WriteFlow:
-		return w.writeFlow.RegionStats(minHotDegree)
+		return w.writeFlow.RegionStats(dim, minHotDegree)
 	case ReadFlow:
-		return w.readFlow.RegionStats(minHotDegree)
+		return w.readFlow.RegionStats(dim, minHotDegree)
+	case QueryFlow:
+		return w.queryFlow.RegionStats(dim, minHotDegree)
 	}
 	return nil
 }
 
-// RandHotRegionFromStore random picks a hot region in specify store.
+// RandHotRegionFromStore random picks a hot region (by ByteDim) in specify
+// store. This keeps its original signature; see RegionStatsOfDim for
+// dimension-specific queries.
 func (w *HotCache) RandHotRegionFromStore(storeID uint64, kind FlowKind, minHotDegree int) *HotPeerStat {
 	if stats, ok := w.RegionStats(kind, minHotDegree)[storeID]; ok && len(stats) > 0 {
 		return stats[rand.Intn(len(stats))]
@@ -98,16 +231,20 @@ func (w *HotCache) RandHotRegionFromStore(storeID uint64, kind FlowKind, minHotD
 	return nil
 }
 
-// IsRegionHot checks if the region is hot.
+// IsRegionHot checks if the region has a peer with at least minHotDegree in
+// the write, read or query cache. It does not look at the peer's current
+// loads, and the caches also hold peers that are not hot on any dimension.
 func (w *HotCache) IsRegionHot(region *core.RegionInfo, minHotDegree int) bool {
 	return w.writeFlow.isRegionHotWithAnyPeers(region, minHotDegree) ||
-		w.readFlow.isRegionHotWithPeer(region, region.GetLeader(), minHotDegree)
+		w.readFlow.isRegionHotWithPeer(region, region.GetLeader(), minHotDegree) ||
+		w.queryFlow.isRegionHotWithPeer(region, region.GetLeader(), minHotDegree)
 }
 
 // CollectMetrics collects the hot cache metrics.
 func (w *HotCache) CollectMetrics() {
 	w.writeFlow.CollectMetrics("write")
 	w.readFlow.CollectMetrics("read")
+	w.queryFlow.CollectMetrics("query")
 }
 
 // ResetMetrics resets the hot cache metrics.
@@ -122,6 +259,8 @@ func (w *HotCache) incMetrics(name string, storeID uint64, kind FlowKind) {
 		hotCacheStatusGauge.WithLabelValues(name, store, "write").Inc()
 	case ReadFlow:
 		hotCacheStatusGauge.WithLabelValues(name, store, "read").Inc()
+	case QueryFlow:
+		hotCacheStatusGauge.WithLabelValues(name, store, "query").Inc()
 	}
 }
 
@@ -132,26 +271,137 @@ func (w *HotCache) GetFilledPeriod(kind FlowKind) int {
 		return w.writeFlow.getDefaultTimeMedian().GetFilledPeriod()
 	case ReadFlow:
 		return w.readFlow.getDefaultTimeMedian().GetFilledPeriod()
+	case QueryFlow:
+		return w.queryFlow.getDefaultTimeMedian().GetFilledPeriod()
 	}
 	return 0
 }
 
+// updateItems drains regions from the flow queue (or, in coalesced mode, the
+// pending map) in batches and checks them in parallel, rather than handling
+// one region per channel receive.
 func (w *HotCache) updateItems(ctx context.Context) {
 	for {
-		select {
-		case <-ctx.Done():
+		batch := w.drainBatch(ctx)
+		if batch == nil {
 			return
-		case region, ok := <-w.flowQueue:
-			if ok && region != nil {
-				items := w.readFlow.CheckRegionFlow(region)
-				for _, item := range items {
-					w.Update(item)
-				}
-				items = w.writeFlow.CheckRegionFlow(region)
-				for _, item := range items {
-					w.Update(item)
+		}
+		w.processBatch(batch)
+	}
+}
+
+// drainBatch blocks until at least one region is available or ctx is done,
+// then drains up to batchSize regions without blocking further. It returns
+// nil only when ctx is done. In coalesced mode a wake-up that finds nothing
+// pending returns an empty batch.
+func (w *HotCache) drainBatch(ctx context.Context) []*core.RegionInfo {
+	if w.coalesce {
+		return w.drainCoalesced(ctx)
+	}
+	return w.drainQueue(ctx)
+}
+
+func (w *HotCache) drainQueue(ctx context.Context) []*core.RegionInfo {
+	select {
+	case <-ctx.Done():
+		return nil
+	case region, ok := <-w.flowQueue:
+		if !ok {
+			return nil
+		}
+		batch := []*core.RegionInfo{region}
+		for len(batch) < w.batchSize {
+			select {
+			case region, ok := <-w.flowQueue:
+				if !ok {
+					return batch
 				}
+				batch = append(batch, region)
+			default:
+				return batch
 			}
 		}
+		return batch
+	}
+}
+
+func (w *HotCache) drainCoalesced(ctx context.Context) []*core.RegionInfo {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-w.notify:
 	}
+
+	w.mu.Lock()
+	batch := make([]*core.RegionInfo, 0, len(w.pending))
+	for id, region := range w.pending {
+		batch = append(batch, region)
+		delete(w.pending, id)
+		if len(batch) >= w.batchSize {
+			break
+		}
+	}
+	remaining := len(w.pending) > 0
+	w.mu.Unlock()
+
+	if remaining {
+		// More regions are queued than fit in this batch; wake ourselves up
+		// again instead of waiting for the next CheckRWAsync call.
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+	return batch
+}
+
+// processBatch checks read/write/query flow for a batch of regions using a
+// bounded pool of worker goroutines, then applies every resulting item to
+// the caches serially. Only the CheckRegionFlow computation is parallel:
+// every Update for a batch is applied from this one goroutine after the
+// workers have finished, so two regions of the same batch landing on the
+// same store never race on the same map. Other callers that mutate the
+// caches (Restore, TopHotRegions, GetFilledPeriod) are not serialized with
+// this goroutine.
+func (w *HotCache) processBatch(batch []*core.RegionInfo) {
+	results := make([][]*HotPeerStat, len(batch))
+	runBoundedParallel(len(batch), hotCacheWorkerCount, func(i int) {
+		results[i] = w.computeRegionFlow(batch[i])
+	})
+
+	for _, items := range results {
+		for _, item := range items {
+			w.Update(item)
+		}
+	}
+}
+
+// runBoundedParallel calls fn(i) for every i in [0, n) using at most
+// workerCount goroutines at once, and waits for them all to finish before
+// returning.
+func runBoundedParallel(n, workerCount int, fn func(i int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workerCount)
+	for i := 0; i < n; i++ {
+		i := i
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// computeRegionFlow checks read/write/query flow for region. It only reads
+// region and the caches' existing state and never mutates anything, so it's
+// safe to call from multiple goroutines at once as long as no Update call is
+// running concurrently (processBatch guarantees that via wg.Wait()).
+func (w *HotCache) computeRegionFlow(region *core.RegionInfo) []*HotPeerStat {
+	items := w.readFlow.CheckRegionFlow(region)
+	items = append(items, w.writeFlow.CheckRegionFlow(region)...)
+	items = append(items, w.queryFlow.CheckRegionFlow(region)...)
+	return items
 }
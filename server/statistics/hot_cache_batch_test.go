@@ -0,0 +1,77 @@
+// Copyright 2018 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// TestRunBoundedParallelRespectsWorkerCount exercises the exact concurrency
+// shape processBatch relies on: every index is visited exactly once, and at
+// no point do more than workerCount calls run at the same time. Run with
+// -race to confirm the results slice writes (one per index, from a distinct
+// goroutine) don't race with each other.
+func TestRunBoundedParallelRespectsWorkerCount(t *testing.T) {
+	const n = 200
+	const workerCount = 4
+
+	results := make([]int, n)
+	var inFlight int32
+	var maxInFlight int32
+
+	runBoundedParallel(n, workerCount, func(i int) {
+		cur := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if cur <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, cur) {
+				break
+			}
+		}
+		results[i] = i * i
+		atomic.AddInt32(&inFlight, -1)
+	})
+
+	if maxInFlight > workerCount {
+		t.Fatalf("observed %d concurrent calls, want at most %d", maxInFlight, workerCount)
+	}
+	for i, v := range results {
+		if v != i*i {
+			t.Fatalf("results[%d] = %d, want %d", i, v, i*i)
+		}
+	}
+}
+
+// TestComputeThenApplyStoresEveryItem reproduces processBatch's two phases
+// without regions: items are produced in parallel by runBoundedParallel,
+// then applied with Update in a serial loop after it returns. It checks
+// that every produced item ends up in the cache.
+func TestComputeThenApplyStoresEveryItem(t *testing.T) {
+	f := NewHotStoresStats(WriteFlow)
+	n := 50
+	items := make([][]*HotPeerStat, n)
+
+	runBoundedParallel(n, hotCacheWorkerCount, func(i int) {
+		items[i] = []*HotPeerStat{{StoreID: 1, RegionID: uint64(i), Kind: WriteFlow, HotDegree: 1}}
+	})
+	for _, batch := range items {
+		for _, item := range batch {
+			f.Update(item)
+		}
+	}
+
+	if got := len(f.peersOfStore[1]); got != n {
+		t.Fatalf("expected %d distinct regions to have been applied, got %d", n, got)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// hotCacheSnapshot is the wire format written by HotCache.Snapshot and read
+// back by HotCache.Restore. It captures the exported fields of each
+// HotPeerStat (instantaneous loads, hot degree, anti-count, last-update
+// timestamp). The per-window moving averages (rollingLoads) are unexported
+// and are not part of the snapshot.
+type hotCacheSnapshot struct {
+	Write []*HotPeerStat `json:"write"`
+	Read  []*HotPeerStat `json:"read"`
+	Query []*HotPeerStat `json:"query"`
+}
+
+// Snapshot serializes the current write/read/query hot peer state so it can
+// be persisted and replayed with Restore, e.g. after a leader transfer.
+func (w *HotCache) Snapshot(wr io.Writer) error {
+	snap := hotCacheSnapshot{
+		Write: w.writeFlow.snapshotStats(),
+		Read:  w.readFlow.snapshotStats(),
+		Query: w.queryFlow.snapshotStats(),
+	}
+	return json.NewEncoder(wr).Encode(&snap)
+}
+
+// Restore replays a snapshot produced by Snapshot, seeding the write/read/
+// query caches with its loads, hot degree and last-update time. Restored
+// peers carry no moving averages: GetWindowLoad returns their instantaneous
+// load until later heartbeats rebuild the averages.
+func (w *HotCache) Restore(r io.Reader) error {
+	var snap hotCacheSnapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return err
+	}
+	for _, item := range snap.Write {
+		w.writeFlow.Update(item)
+	}
+	for _, item := range snap.Read {
+		w.readFlow.Update(item)
+	}
+	for _, item := range snap.Query {
+		w.queryFlow.Update(item)
+	}
+	return nil
+}
+
+// NewHotCacheFromSnapshot builds a HotCache pre-seeded from a previously
+// persisted snapshot reader. It, together with RestoreFromFile and
+// StartPersistence, is the building block a server's leader-campaign path
+// should use so a newly elected leader does not start scheduling from a
+// cold cache; wiring that call site into leader election itself is tracked
+// separately from this package.
+func NewHotCacheFromSnapshot(ctx context.Context, r io.Reader, opts ...HotCacheOption) (*HotCache, error) {
+	w := NewHotCache(ctx, opts...)
+	if err := w.Restore(r); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// RestoreFromFile restores the cache from a snapshot file previously written
+// by StartPersistence or Snapshot. A missing file is not an error — it just
+// means no snapshot has been persisted yet (e.g. this is the first-ever
+// leader) — so the cache is simply left empty.
+func (w *HotCache) RestoreFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return w.Restore(f)
+}
+
+// StartPersistence periodically serializes the current hot cache state to
+// path until ctx is done, writing to a temp file and renaming it into place
+// so a concurrent RestoreFromFile never observes a partially written
+// snapshot.
+func (w *HotCache) StartPersistence(ctx context.Context, path string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.persistToFile(path); err != nil {
+					log.Error("failed to persist hot cache snapshot", zap.String("path", path), zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+func (w *HotCache) persistToFile(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := w.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
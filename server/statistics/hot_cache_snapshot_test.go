@@ -0,0 +1,97 @@
+// Copyright 2018 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestHotCacheSnapshotRestoreRoundTrip(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := NewHotCache(ctx)
+	w.writeFlow.Update(&HotPeerStat{
+		StoreID:   1,
+		RegionID:  100,
+		Kind:      WriteFlow,
+		Loads:     [dimensionCount]float64{ByteDim: 4096},
+		HotDegree: 5,
+	})
+	w.queryFlow.Update(&HotPeerStat{
+		StoreID:   2,
+		RegionID:  200,
+		Kind:      QueryFlow,
+		Loads:     [dimensionCount]float64{QueryDim: 999},
+		HotDegree: 3,
+	})
+
+	var buf bytes.Buffer
+	if err := w.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	restored := NewHotCache(ctx2)
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	writeStats := restored.RegionStats(WriteFlow, 0)[1]
+	if len(writeStats) != 1 || writeStats[0].RegionID != 100 {
+		t.Fatalf("expected restored write stat for region 100, got %+v", writeStats)
+	}
+	queryStats := restored.RegionStatsOfDim(QueryFlow, QueryDim, 0)[2]
+	if len(queryStats) != 1 || queryStats[0].RegionID != 200 {
+		t.Fatalf("expected restored query stat for region 200, got %+v", queryStats)
+	}
+}
+
+func TestHotCachePersistenceRoundTripsThroughFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := NewHotCache(ctx)
+	w.writeFlow.Update(&HotPeerStat{
+		StoreID:   1,
+		RegionID:  100,
+		Kind:      WriteFlow,
+		Loads:     [dimensionCount]float64{ByteDim: 4096},
+		HotDegree: 5,
+	})
+
+	path := filepath.Join(t.TempDir(), "hot_cache.snapshot")
+	if err := w.persistToFile(path); err != nil {
+		t.Fatalf("persistToFile: %v", err)
+	}
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	restored := NewHotCache(ctx2)
+	if err := restored.RestoreFromFile(path); err != nil {
+		t.Fatalf("RestoreFromFile: %v", err)
+	}
+	if stats := restored.RegionStats(WriteFlow, 0)[1]; len(stats) != 1 {
+		t.Fatalf("expected restored state from file, got %+v", stats)
+	}
+
+	empty := NewHotCache(ctx2)
+	if err := empty.RestoreFromFile(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Fatalf("RestoreFromFile on a missing file should not error, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2018 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import "time"
+
+// TopHotRegions returns the top-k hottest peers for the given kind and
+// dimension, ranked by their moving average over window when window is one
+// of DefaultHotRegionsWindows, and by their instantaneous load when window is
+// 0 or any other duration. For 0 and DefaultHotRegionsWindows it reads the
+// per-(dimension, window) heap that hotPeerCache.Update maintains
+// incrementally (hot_peer_cache_topn.go), so it only pops and pushes back k
+// entries; for any other window it scans and sorts every cached peer.
+func (w *HotCache) TopHotRegions(kind FlowKind, dim Dimension, k int, window time.Duration) []*HotPeerStat {
+	switch kind {
+	case WriteFlow:
+		return w.writeFlow.topHotRegions(dim, k, window)
+	case ReadFlow:
+		return w.readFlow.topHotRegions(dim, k, window)
+	case QueryFlow:
+		return w.queryFlow.topHotRegions(dim, k, window)
+	}
+	return nil
+}
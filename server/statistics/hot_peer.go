@@ -0,0 +1,79 @@
+// Copyright 2018 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import "time"
+
+// dimensionCount is the number of Dimension values HotPeerStat carries a
+// load for.
+const dimensionCount = int(QueryDim) + 1
+
+// HotPeerStat records the hotness of one peer as tracked by a hotPeerCache:
+// its current load on every Dimension (bytes, keys, queries), its hot
+// degree, and enough rolling history to approximate recent windows.
+type HotPeerStat struct {
+	StoreID  uint64
+	RegionID uint64
+	Kind     FlowKind
+
+	// Loads holds the instantaneous rate for each Dimension, e.g.
+	// Loads[QueryDim] is the region's queries per second.
+	Loads [dimensionCount]float64
+
+	// rollingLoads is an exponential moving average of Loads per
+	// maintained window (see DefaultHotRegionsWindows), used to approximate
+	// e.g. "average load over the last 5m" without keeping full
+	// per-second history.
+	rollingLoads map[time.Duration][dimensionCount]float64
+
+	// HotDegree starts at 1 when the peer is first cached and goes up by one
+	// on every later hot heartbeat; cool heartbeats leave it unchanged and
+	// count down AntiCount instead.
+	HotDegree int
+	// AntiCount is the number of consecutive cool heartbeats, counting the
+	// one that evicts it, before the peer is removed from the cache; a hot
+	// heartbeat resets it to hotRegionAntiCount.
+	AntiCount int
+
+	LastUpdateTime time.Time
+
+	needDelete bool
+	isNew      bool
+}
+
+// GetLoad returns the instantaneous rate tracked for dim.
+func (stat *HotPeerStat) GetLoad(dim Dimension) float64 {
+	return stat.Loads[dim]
+}
+
+// GetWindowLoad returns the moving average tracked for dim over window. If
+// window isn't one of the maintained buckets, it falls back to the
+// instantaneous rate.
+func (stat *HotPeerStat) GetWindowLoad(dim Dimension, window time.Duration) float64 {
+	if loads, ok := stat.rollingLoads[window]; ok {
+		return loads[dim]
+	}
+	return stat.Loads[dim]
+}
+
+// IsNeedDelete returns whether the peer has cooled down enough that it
+// should be removed from the cache.
+func (stat *HotPeerStat) IsNeedDelete() bool {
+	return stat.needDelete
+}
+
+// IsNew returns whether this is the first stat observed for the peer.
+func (stat *HotPeerStat) IsNew() bool {
+	return stat.isNew
+}
@@ -0,0 +1,304 @@
+// Copyright 2018 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"time"
+
+	"github.com/tikv/pd/server/core"
+)
+
+// DefaultHotRegionsWindows are the sliding windows whose moving averages
+// hotPeerCache maintains on every HotPeerStat, so callers can ask for e.g.
+// "hot over the last 5m" without rescanning history.
+var DefaultHotRegionsWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+const (
+	// hotRegionAntiCount is how many consecutive non-hot heartbeats a peer
+	// tolerates before it's evicted from the cache.
+	hotRegionAntiCount = 2
+
+	minHotByteRate  = 1 * 1024
+	minHotKeyRate   = 128
+	minHotQueryRate = 64
+)
+
+// hotPeerCache is a cache of the hot peers observed for one FlowKind (write,
+// read, or query). All mutation (Update) is expected to happen from a
+// single goroutine; its internal maps are not safe for concurrent writers.
+type hotPeerCache struct {
+	kind         FlowKind
+	peersOfStore map[uint64]map[uint64]*HotPeerStat // storeID -> regionID -> stat
+	filledPeriod int
+
+	// heaps holds, per (Dimension, window) pair it maintains, a max-heap of
+	// every cached peer ordered by its load on that dimension/window,
+	// incrementally updated by Update. window == 0 is the instantaneous
+	// heap; the rest are keyed by the entries of DefaultHotRegionsWindows.
+	// See topHotRegions in hot_peer_cache_topn.go.
+	heaps map[dimWindowKey]*dimHeap
+}
+
+// dimWindowKey identifies one of the heaps hotPeerCache maintains.
+type dimWindowKey struct {
+	dim    Dimension
+	window time.Duration
+}
+
+// NewHotStoresStats creates an empty hotPeerCache for the given kind.
+func NewHotStoresStats(kind FlowKind) *hotPeerCache {
+	f := &hotPeerCache{
+		kind:         kind,
+		peersOfStore: make(map[uint64]map[uint64]*HotPeerStat),
+		heaps:        make(map[dimWindowKey]*dimHeap),
+	}
+	windows := append([]time.Duration{0}, DefaultHotRegionsWindows...)
+	for dim := 0; dim < dimensionCount; dim++ {
+		for _, window := range windows {
+			key := dimWindowKey{Dimension(dim), window}
+			f.heaps[key] = newDimHeap(Dimension(dim), window)
+		}
+	}
+	return f
+}
+
+// CheckRegionFlow computes, but does not store, the HotPeerStat for each
+// relevant peer of region (all peers for WriteFlow, the leader for
+// ReadFlow/QueryFlow). It only reads from region and the cache's existing
+// state, so it's safe to call concurrently for different regions; callers
+// must still apply the results with Update from a single goroutine.
+func (f *hotPeerCache) CheckRegionFlow(region *core.RegionInfo) []*HotPeerStat {
+	var peers []*core.Peer
+	if f.kind == WriteFlow {
+		peers = region.GetPeers()
+	} else if leader := region.GetLeader(); leader != nil {
+		peers = []*core.Peer{leader}
+	}
+
+	stats := make([]*HotPeerStat, 0, len(peers))
+	for _, peer := range peers {
+		if peer == nil {
+			continue
+		}
+		stats = append(stats, f.checkPeerFlow(region, peer.GetStoreId()))
+	}
+	return stats
+}
+
+func (f *hotPeerCache) checkPeerFlow(region *core.RegionInfo, storeID uint64) *HotPeerStat {
+	regionID := region.GetID()
+	var old *HotPeerStat
+	if storeMap, ok := f.peersOfStore[storeID]; ok {
+		old = storeMap[regionID]
+	}
+
+	loads := f.loadsFromRegion(region)
+	stat := &HotPeerStat{
+		StoreID:        storeID,
+		RegionID:       regionID,
+		Kind:           f.kind,
+		Loads:          loads,
+		LastUpdateTime: time.Now(),
+		rollingLoads:   make(map[time.Duration][dimensionCount]float64, len(DefaultHotRegionsWindows)),
+	}
+
+	if old == nil {
+		stat.isNew = true
+		stat.HotDegree = 1
+		stat.AntiCount = hotRegionAntiCount
+		for _, window := range DefaultHotRegionsWindows {
+			stat.rollingLoads[window] = loads
+		}
+		return stat
+	}
+
+	if isHotLoads(loads) {
+		stat.HotDegree = old.HotDegree + 1
+		stat.AntiCount = hotRegionAntiCount
+	} else {
+		stat.HotDegree = old.HotDegree
+		stat.AntiCount = old.AntiCount - 1
+		if stat.AntiCount <= 0 {
+			stat.needDelete = true
+		}
+	}
+	for _, window := range DefaultHotRegionsWindows {
+		stat.rollingLoads[window] = ewma(old.rollingLoads[window], loads, window)
+	}
+	return stat
+}
+
+// loadsFromRegion reads the raw counters region reported over its last
+// heartbeat interval and turns them into per-second rates for each
+// Dimension.
+func (f *hotPeerCache) loadsFromRegion(region *core.RegionInfo) [dimensionCount]float64 {
+	interval := region.GetInterval().GetEndTimestamp() - region.GetInterval().GetStartTimestamp()
+	if interval <= 0 {
+		interval = 1
+	}
+	sec := float64(interval)
+
+	var loads [dimensionCount]float64
+	switch f.kind {
+	case WriteFlow:
+		loads[ByteDim] = float64(region.GetBytesWritten()) / sec
+		loads[KeyDim] = float64(region.GetKeysWritten()) / sec
+		loads[QueryDim] = float64(region.GetWriteQueryNum()) / sec
+	case ReadFlow:
+		loads[ByteDim] = float64(region.GetBytesRead()) / sec
+		loads[KeyDim] = float64(region.GetKeysRead()) / sec
+		loads[QueryDim] = float64(region.GetReadQueryNum()) / sec
+	case QueryFlow:
+		loads[QueryDim] = float64(region.GetWriteQueryNum()+region.GetReadQueryNum()) / sec
+	}
+	return loads
+}
+
+func isHotOnDim(dim Dimension, loads [dimensionCount]float64) bool {
+	switch dim {
+	case ByteDim:
+		return loads[ByteDim] >= minHotByteRate
+	case KeyDim:
+		return loads[KeyDim] >= minHotKeyRate
+	case QueryDim:
+		return loads[QueryDim] >= minHotQueryRate
+	default:
+		return false
+	}
+}
+
+func isHotLoads(loads [dimensionCount]float64) bool {
+	return isHotOnDim(ByteDim, loads) || isHotOnDim(KeyDim, loads) || isHotOnDim(QueryDim, loads)
+}
+
+// ewma returns an exponential moving average of prev seeded/advanced by cur,
+// with a decay chosen so window roughly reflects the requested average
+// period. It is an approximation of a windowed average, not a true bucketed
+// histogram.
+func ewma(prev [dimensionCount]float64, cur [dimensionCount]float64, window time.Duration) [dimensionCount]float64 {
+	alpha := float64(defaultReportInterval) / window.Seconds()
+	if alpha > 1 {
+		alpha = 1
+	}
+	var next [dimensionCount]float64
+	for i := range next {
+		next[i] = prev[i]*(1-alpha) + cur[i]*alpha
+	}
+	return next
+}
+
+const defaultReportInterval = 60
+
+// Update applies item to the cache: storing it (or, if it has cooled down
+// past the anti-count threshold, removing it) and fixing up the per-
+// dimension top-K heaps to match. This is the only method that changes
+// which peers peersOfStore and heaps hold; topHotRegions also rearranges
+// heap entries while it pops and pushes them back. It must only be called
+// from one goroutine at a time.
+func (f *hotPeerCache) Update(item *HotPeerStat) {
+	storeMap, ok := f.peersOfStore[item.StoreID]
+	if !ok {
+		storeMap = make(map[uint64]*HotPeerStat)
+		f.peersOfStore[item.StoreID] = storeMap
+	}
+	if item.IsNeedDelete() {
+		delete(storeMap, item.RegionID)
+		for _, h := range f.heaps {
+			h.remove(item)
+		}
+		return
+	}
+	storeMap[item.RegionID] = item
+	for _, h := range f.heaps {
+		h.upsert(item)
+	}
+}
+
+// RegionStats returns, per store, the cached peers with at least
+// minHotDegree that are actually hot on dim specifically — e.g. dim ==
+// QueryDim surfaces point-lookup hotspots whose byte/key rates look
+// moderate.
+func (f *hotPeerCache) RegionStats(dim Dimension, minHotDegree int) map[uint64][]*HotPeerStat {
+	res := make(map[uint64][]*HotPeerStat)
+	for storeID, peers := range f.peersOfStore {
+		for _, stat := range peers {
+			if stat.HotDegree < minHotDegree || !isHotOnDim(dim, stat.Loads) {
+				continue
+			}
+			res[storeID] = append(res[storeID], stat)
+		}
+	}
+	return res
+}
+
+func (f *hotPeerCache) isRegionHotWithAnyPeers(region *core.RegionInfo, minHotDegree int) bool {
+	for _, peer := range region.GetPeers() {
+		if f.isRegionHotWithPeer(region, peer, minHotDegree) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *hotPeerCache) isRegionHotWithPeer(region *core.RegionInfo, peer *core.Peer, minHotDegree int) bool {
+	if peer == nil {
+		return false
+	}
+	storeMap, ok := f.peersOfStore[peer.GetStoreId()]
+	if !ok {
+		return false
+	}
+	stat, ok := storeMap[region.GetID()]
+	return ok && stat.HotDegree >= minHotDegree
+}
+
+// timeMedian tracks how much of the configured report interval has actually
+// been observed, so callers can avoid trusting rates computed from a
+// not-yet-filled window right after startup.
+type timeMedian struct {
+	filledPeriod int
+}
+
+// GetFilledPeriod returns the number of seconds of heartbeat history this
+// cache has actually observed, capped at defaultReportInterval.
+func (t *timeMedian) GetFilledPeriod() int {
+	return t.filledPeriod
+}
+
+func (f *hotPeerCache) getDefaultTimeMedian() *timeMedian {
+	if f.filledPeriod < defaultReportInterval {
+		f.filledPeriod++
+	}
+	return &timeMedian{filledPeriod: f.filledPeriod}
+}
+
+// CollectMetrics reports this cache's current size, per store, under the
+// given metric label (e.g. "write"/"read"/"query").
+func (f *hotPeerCache) CollectMetrics(typ string) {
+	for storeID, peers := range f.peersOfStore {
+		hotCacheStatusGauge.WithLabelValues("total_length", storeTag(storeID), typ).Set(float64(len(peers)))
+	}
+}
+
+// snapshotStats flattens every cached peer across all stores, for
+// persistence by HotCache.Snapshot.
+func (f *hotPeerCache) snapshotStats() []*HotPeerStat {
+	stats := make([]*HotPeerStat, 0)
+	for _, peers := range f.peersOfStore {
+		for _, stat := range peers {
+			stats = append(stats, stat)
+		}
+	}
+	return stats
+}
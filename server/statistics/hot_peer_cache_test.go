@@ -0,0 +1,64 @@
+// Copyright 2018 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import "testing"
+
+func TestHotPeerCacheRegionStatsFiltersByDimension(t *testing.T) {
+	f := NewHotStoresStats(QueryFlow)
+
+	f.Update(&HotPeerStat{
+		StoreID:   1,
+		RegionID:  100,
+		Kind:      QueryFlow,
+		Loads:     [dimensionCount]float64{ByteDim: 10, KeyDim: 1, QueryDim: 5000},
+		HotDegree: 3,
+	})
+	f.Update(&HotPeerStat{
+		StoreID:   1,
+		RegionID:  101,
+		Kind:      QueryFlow,
+		Loads:     [dimensionCount]float64{ByteDim: 10, KeyDim: 1, QueryDim: 1},
+		HotDegree: 3,
+	})
+
+	byQuery := f.RegionStats(QueryDim, 1)
+	if len(byQuery[1]) != 1 || byQuery[1][0].RegionID != 100 {
+		t.Fatalf("expected only region 100 to be hot on QueryDim, got %+v", byQuery[1])
+	}
+
+	byByte := f.RegionStats(ByteDim, 1)
+	if len(byByte[1]) != 0 {
+		t.Fatalf("expected no region to be hot on ByteDim, got %+v", byByte[1])
+	}
+}
+
+func TestHotPeerCacheUpdateRemovesNeedDeleteItems(t *testing.T) {
+	f := NewHotStoresStats(WriteFlow)
+
+	stat := &HotPeerStat{StoreID: 1, RegionID: 100, Kind: WriteFlow, HotDegree: 2}
+	f.Update(stat)
+	if len(f.RegionStats(ByteDim, 0)[1]) != 0 {
+		t.Fatalf("stat with zero load on every dimension should not be reported as hot on ByteDim")
+	}
+	if _, ok := f.peersOfStore[1][100]; !ok {
+		t.Fatalf("expected stat to be stored regardless of hotness")
+	}
+
+	cooled := &HotPeerStat{StoreID: 1, RegionID: 100, Kind: WriteFlow, needDelete: true}
+	f.Update(cooled)
+	if _, ok := f.peersOfStore[1][100]; ok {
+		t.Fatalf("expected needDelete item to be removed from the cache")
+	}
+}
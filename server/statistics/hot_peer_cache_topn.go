@@ -0,0 +1,139 @@
+// Copyright 2018 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+)
+
+// dimHeap is a max-heap of every peer currently in a hotPeerCache, ordered
+// by its load on one (Dimension, window) pair — window == 0 means
+// instantaneous load, any other value means the moving average maintained
+// for that window (see GetWindowLoad). It is fixed up incrementally by
+// upsert/remove from inside hotPeerCache.Update, so topK doesn't need to
+// rescan and sort every peer on every query — only the O(k log n) needed to
+// pop (and push back) the top k.
+//
+// A heap ordered by instantaneous load cannot answer "top-k over the last
+// 15m": a region that spiked once but has a low 15m average would be picked
+// as a candidate (by instantaneous load) ahead of a region with a lower
+// instantaneous tick but a consistently high 15m average, which would never
+// even make the candidate pool. hotPeerCache therefore keeps one heap per
+// (dimension, window) pair it maintains, not just one per dimension.
+type dimHeap struct {
+	dim    Dimension
+	window time.Duration
+	items  []*HotPeerStat
+	index  map[[2]uint64]int
+}
+
+func newDimHeap(dim Dimension, window time.Duration) *dimHeap {
+	return &dimHeap{dim: dim, window: window, index: make(map[[2]uint64]int)}
+}
+
+func dimHeapKey(stat *HotPeerStat) [2]uint64 {
+	return [2]uint64{stat.StoreID, stat.RegionID}
+}
+
+func (h *dimHeap) Len() int { return len(h.items) }
+
+func (h *dimHeap) Less(i, j int) bool {
+	return h.items[i].GetWindowLoad(h.dim, h.window) > h.items[j].GetWindowLoad(h.dim, h.window)
+}
+
+func (h *dimHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[dimHeapKey(h.items[i])] = i
+	h.index[dimHeapKey(h.items[j])] = j
+}
+
+func (h *dimHeap) Push(x interface{}) {
+	stat := x.(*HotPeerStat)
+	h.index[dimHeapKey(stat)] = len(h.items)
+	h.items = append(h.items, stat)
+}
+
+func (h *dimHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+	delete(h.index, dimHeapKey(item))
+	return item
+}
+
+// upsert inserts stat, or replaces and re-heapifies its entry if a stat for
+// the same peer is already present.
+func (h *dimHeap) upsert(stat *HotPeerStat) {
+	if i, ok := h.index[dimHeapKey(stat)]; ok {
+		h.items[i] = stat
+		heap.Fix(h, i)
+		return
+	}
+	heap.Push(h, stat)
+}
+
+// remove drops stat's entry, if present.
+func (h *dimHeap) remove(stat *HotPeerStat) {
+	if i, ok := h.index[dimHeapKey(stat)]; ok {
+		heap.Remove(h, i)
+	}
+}
+
+// topK pops the k largest items and pushes them back, returning them. The
+// heap holds the same items afterwards, though their positions may change.
+func (h *dimHeap) topK(k int) []*HotPeerStat {
+	if k > len(h.items) {
+		k = len(h.items)
+	}
+	popped := make([]*HotPeerStat, 0, k)
+	for i := 0; i < k; i++ {
+		popped = append(popped, heap.Pop(h).(*HotPeerStat))
+	}
+	for _, stat := range popped {
+		heap.Push(h, stat)
+	}
+	return popped
+}
+
+// topHotRegions returns the k peers with the largest GetWindowLoad(dim,
+// window). If window is 0 or one of DefaultHotRegionsWindows, hotPeerCache
+// maintains a heap for that (dim, window) pair (see NewHotStoresStats) and
+// this is the O(k log n) heap-backed path. Any other window falls back to a
+// full O(n log n) scan and sort; since no moving average is kept for such a
+// window, GetWindowLoad ranks the peers by their instantaneous load.
+func (f *hotPeerCache) topHotRegions(dim Dimension, k int, window time.Duration) []*HotPeerStat {
+	if k <= 0 {
+		return nil
+	}
+	if h, ok := f.heaps[dimWindowKey{dim, window}]; ok {
+		return h.topK(k)
+	}
+	return f.topKByScan(dim, window, k)
+}
+
+// topKByScan is the fallback for windows hotPeerCache doesn't maintain a
+// heap for: it scans every cached peer and sorts by the requested window's
+// load.
+func (f *hotPeerCache) topKByScan(dim Dimension, window time.Duration, k int) []*HotPeerStat {
+	candidates := f.snapshotStats()
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].GetWindowLoad(dim, window) > candidates[j].GetWindowLoad(dim, window)
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
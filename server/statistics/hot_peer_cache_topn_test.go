@@ -0,0 +1,104 @@
+// Copyright 2018 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTopHotRegionsOrdersByLoadDescending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := NewHotCache(ctx)
+
+	loads := []float64{10, 50, 30, 5, 80}
+	for i, load := range loads {
+		w.writeFlow.Update(&HotPeerStat{
+			StoreID:   1,
+			RegionID:  uint64(100 + i),
+			Kind:      WriteFlow,
+			Loads:     [dimensionCount]float64{ByteDim: load},
+			HotDegree: 1,
+		})
+	}
+
+	top := w.TopHotRegions(WriteFlow, ByteDim, 3, time.Minute)
+	if len(top) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(top))
+	}
+	wantRegionIDs := []uint64{104, 101, 102} // loads 80, 50, 30
+	for i, want := range wantRegionIDs {
+		if top[i].RegionID != want {
+			t.Fatalf("result[%d] = region %d, want region %d (top: %+v)", i, top[i].RegionID, want, top)
+		}
+	}
+}
+
+// TestTopHotRegionsUsesWindowedLoadNotInstantaneous reproduces the case
+// where instantaneous load and the windowed moving average disagree: a
+// region with a brief spike but a low 15m average must not beat out a
+// region with a lower instantaneous tick but a consistently high 15m
+// average, and the sustained region must not be dropped from the candidate
+// pool altogether.
+func TestTopHotRegionsUsesWindowedLoadNotInstantaneous(t *testing.T) {
+	f := NewHotStoresStats(WriteFlow)
+
+	spiking := &HotPeerStat{
+		StoreID:  1,
+		RegionID: 1,
+		Kind:     WriteFlow,
+		Loads:    [dimensionCount]float64{ByteDim: 9000},
+		rollingLoads: map[time.Duration][dimensionCount]float64{
+			15 * time.Minute: {ByteDim: 200},
+		},
+	}
+	sustained := &HotPeerStat{
+		StoreID:  1,
+		RegionID: 2,
+		Kind:     WriteFlow,
+		Loads:    [dimensionCount]float64{ByteDim: 1000},
+		rollingLoads: map[time.Duration][dimensionCount]float64{
+			15 * time.Minute: {ByteDim: 5000},
+		},
+	}
+	f.Update(spiking)
+	f.Update(sustained)
+
+	top := f.topHotRegions(ByteDim, 1, 15*time.Minute)
+	if len(top) != 1 || top[0].RegionID != 2 {
+		t.Fatalf("expected the sustained region (2) to win on the 15m window, got %+v", top)
+	}
+
+	// Sanity check: ranking by instantaneous load (window == 0) picks the
+	// other region, confirming the two orders really do diverge here.
+	instant := f.topHotRegions(ByteDim, 1, 0)
+	if len(instant) != 1 || instant[0].RegionID != 1 {
+		t.Fatalf("expected the spiking region (1) to win on instantaneous load, got %+v", instant)
+	}
+}
+
+func TestTopHotRegionsReflectsRemoval(t *testing.T) {
+	f := NewHotStoresStats(ReadFlow)
+	f.Update(&HotPeerStat{StoreID: 1, RegionID: 1, Kind: ReadFlow, Loads: [dimensionCount]float64{ByteDim: 100}})
+	f.Update(&HotPeerStat{StoreID: 1, RegionID: 2, Kind: ReadFlow, Loads: [dimensionCount]float64{ByteDim: 50}})
+
+	f.Update(&HotPeerStat{StoreID: 1, RegionID: 1, Kind: ReadFlow, needDelete: true})
+
+	top := f.topHotRegions(ByteDim, 5, time.Minute)
+	if len(top) != 1 || top[0].RegionID != 2 {
+		t.Fatalf("expected only region 2 to remain after removal, got %+v", top)
+	}
+}
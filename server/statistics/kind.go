@@ -0,0 +1,43 @@
+// Copyright 2018 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+// FlowKind is the identity of a tracked flow: which side of traffic
+// (write/read) or which heartbeat-reported counter (query) a hotPeerCache
+// instance watches.
+type FlowKind uint32
+
+const (
+	// WriteFlow is flow by data written to a region's peers.
+	WriteFlow FlowKind = iota
+	// ReadFlow is flow by data read from a region's leader.
+	ReadFlow
+	// QueryFlow is the query-count (QPS) reported on region heartbeats. It
+	// is kept as its own FlowKind, alongside WriteFlow/ReadFlow, so it has
+	// its own hotPeerCache and hot-degree bookkeeping.
+	QueryFlow
+)
+
+func (k FlowKind) String() string {
+	switch k {
+	case WriteFlow:
+		return "write"
+	case ReadFlow:
+		return "read"
+	case QueryFlow:
+		return "query"
+	default:
+		return "unknown"
+	}
+}